@@ -0,0 +1,114 @@
+// order-consumer subscribes to PaymentCompleted events and marks the
+// matching order paid, replacing the synchronous HTTP callback
+// payment-service used to make directly into order-service.
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+	"github.com/mbaykara/opentelemetry-webshop/pkg/model"
+	"github.com/mbaykara/opentelemetry-webshop/pkg/msg"
+	"github.com/mbaykara/opentelemetry-webshop/pkg/tracing"
+	"github.com/uptrace/opentelemetry-go-extra/otelgorm"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+var db *gorm.DB
+
+func main() {
+	var err error
+	dbUser := os.Getenv("DB_USER")
+	dbPassword := os.Getenv("DB_PASSWORD")
+	dbName := os.Getenv("DB_NAME")
+	dbHost := os.Getenv("DB_HOST")
+	dsn := dbUser + ":" + dbPassword + "@tcp(" + dbHost + ":3306)/" + dbName + "?parseTime=True"
+	db, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	if err != nil {
+		panic(err)
+	}
+	if err := db.Use(otelgorm.NewPlugin()); err != nil {
+		panic(err)
+	}
+
+	tp, err := tracing.Init(context.Background(), "order-consumer")
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		if err := tp.Shutdown(context.Background()); err != nil {
+			panic(err)
+		}
+	}()
+
+	logger := watermill.NewStdLogger(false, false)
+
+	subscriber, err := msg.NewSubscriber(logger)
+	if err != nil {
+		panic(err)
+	}
+
+	router, err := message.NewRouter(message.RouterConfig{}, logger)
+	if err != nil {
+		panic(err)
+	}
+
+	router.AddMiddleware(middleware.Retry{
+		MaxRetries:      3,
+		InitialInterval: 3 * time.Second,
+		Logger:          logger,
+	}.Middleware)
+
+	router.AddNoPublisherHandler(
+		"mark_order_paid",
+		msg.PaymentCompletedTopic,
+		subscriber,
+		handlePaymentCompleted,
+	)
+
+	if err := router.Run(context.Background()); err != nil {
+		panic(err)
+	}
+}
+
+func handlePaymentCompleted(m *message.Message) error {
+	event, ctx, err := msg.ExtractPaymentCompleted(m)
+	if err != nil {
+		return err
+	}
+	span := trace.SpanFromContext(ctx)
+	defer span.End()
+
+	if err := markOrderPaid(ctx, event); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "failed to mark order paid")
+		return err
+	}
+	return nil
+}
+
+// markOrderPaid applies event idempotently: a redelivered event for a
+// payment that has already been applied to the order is a no-op.
+func markOrderPaid(ctx context.Context, event msg.PaymentCompleted) error {
+	var order model.Order
+	if err := db.WithContext(ctx).First(&order, event.OrderID).Error; err != nil {
+		return err
+	}
+
+	if order.Paid && order.PaymentID == event.PaymentID {
+		log.Printf("order %d already marked paid by payment %d, skipping", order.ID, event.PaymentID)
+		return nil
+	}
+
+	order.Paid = true
+	order.PaymentID = event.PaymentID
+	return db.WithContext(ctx).Save(&order).Error
+}
@@ -4,60 +4,38 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	_ "github.com/go-sql-driver/mysql"
-	"github.com/jinzhu/gorm"
+	"github.com/mbaykara/opentelemetry-webshop/pkg/httpserver"
+	"github.com/mbaykara/opentelemetry-webshop/pkg/metrics"
+	"github.com/mbaykara/opentelemetry-webshop/pkg/model"
+	"github.com/mbaykara/opentelemetry-webshop/pkg/tracing"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/uptrace/opentelemetry-go-extra/otelgorm"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
-	"go.opentelemetry.io/otel/propagation"
-	"go.opentelemetry.io/otel/sdk/resource"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
-	"go.opentelemetry.io/otel/trace"
+	otelmetric "go.opentelemetry.io/otel/metric"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
 )
 
-type Order struct {
-	ID     uint   `json:"id" gorm:"primary_key"`
-	Item   string `json:"item"`
-	Amount int    `json:"amount"`
-	Paid   bool   `json:"paid"`
-}
+// Order is an alias for model.Order so order-consumer shares the exact same
+// schema without having to import order-service's main package.
+type Order = model.Order
 
-var db *gorm.DB
+var (
+	db          *gorm.DB
+	instruments *metrics.Instruments
+)
 
 const PORT = "8090"
 
-func initTracer() (*sdktrace.TracerProvider, error) {
-	otlp_endpoint := os.Getenv("OTLP_ENDPOINT")
-	if otlp_endpoint == "" {
-		log.Println("OTLP_ENDPOINT is not set, using tempo")
-		otlp_endpoint = "tempo:4317"
-	}
-	exporter, err := otlptracegrpc.New(context.Background(), otlptracegrpc.WithEndpoint(otlp_endpoint), otlptracegrpc.WithInsecure())
-	if err != nil {
-		return nil, err
-	}
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
-		sdktrace.WithResource(resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.ServiceNameKey.String("order-service"),
-		)),
-	)
-
-	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
-	return tp, nil
-}
-
 func main() {
 	var err error
 	os.Setenv("PORT", PORT)
@@ -65,15 +43,23 @@ func main() {
 	dbPassword := os.Getenv("DB_PASSWORD")
 	dbName := os.Getenv("DB_NAME")
 	dbHost := os.Getenv("DB_HOST")
-	db, err = gorm.Open("mysql", dbUser+":"+dbPassword+"@tcp("+dbHost+":3306)/"+dbName+"?parseTime=True")
+	dsn := dbUser + ":" + dbPassword + "@tcp(" + dbHost + ":3306)/" + dbName + "?parseTime=True"
+	db, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	if err != nil {
+		panic(err)
+	}
+	if err := db.Use(otelgorm.NewPlugin()); err != nil {
+		panic(err)
+	}
+	sqlDB, err := db.DB()
 	if err != nil {
 		panic(err)
 	}
-	defer db.Close()
+	defer sqlDB.Close()
 
 	db.AutoMigrate(&Order{})
 
-	tp, err := initTracer()
+	tp, err := tracing.Init(context.Background(), "order-service")
 	if err != nil {
 		panic(err)
 	}
@@ -83,24 +69,22 @@ func main() {
 		}
 	}()
 
-	router := gin.Default()
-	router.Use(func(c *gin.Context) {
-		ctx := c.Request.Context()
-		traceID := trace.SpanFromContext(ctx).SpanContext().TraceID()
-		c.Set("traceID", traceID.String())
-		c.Next()
-	}, gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
-		return fmt.Sprintf("clientIP: %s Method: %s Path: %s Req: %s StatusCode %d Latency: %s Agent: %s traceID: %s\"\n",
-			param.ClientIP,
-			param.Method,
-			param.Path,
-			param.Request.Proto,
-			param.StatusCode,
-			param.Latency,
-			param.Request.UserAgent(),
-			param.Keys["traceID"].(string),
-		)
-	}))
+	mp, instr, err := metrics.Init(context.Background(), "order-service")
+	if err != nil {
+		panic(err)
+	}
+	instruments = instr
+	defer func() {
+		if err := mp.Shutdown(context.Background()); err != nil {
+			panic(err)
+		}
+	}()
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.Use(httpserver.Middleware("order-service", logger, instruments)...)
 	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 	router.POST("/orders", createOrder)
 	router.GET("/orders/:id", getOrder)
@@ -135,6 +119,10 @@ func createOrder(c *gin.Context) {
 		attribute.Int("amount", order.Amount),
 	)
 
+	instruments.OrdersCreated.Add(ctx, 1, otelmetric.WithAttributes(
+		attribute.String("item", order.Item),
+	))
+
 	c.JSON(http.StatusCreated, order)
 }
 
@@ -144,7 +132,10 @@ func createOrderWithContext(ctx context.Context, order *Order) error {
 	_, span := tracer.Start(ctx, "trace: create order in db")
 	defer span.End()
 
-	if err := db.Create(order).Error; err != nil {
+	start := time.Now()
+	err := db.WithContext(ctx).Create(order).Error
+	instruments.RecordDBOperation(ctx, "INSERT", "orders", start)
+	if err != nil {
 		span.SetStatus(codes.Error, "Failed to create order in database")
 		return err
 	}
@@ -153,13 +144,16 @@ func createOrderWithContext(ctx context.Context, order *Order) error {
 }
 
 func getOrder(c *gin.Context) {
-	_, span := otel.Tracer("order-service").Start(c.Request.Context(), "getOrder")
+	ctx, span := otel.Tracer("order-service").Start(c.Request.Context(), "getOrder")
 	defer span.End()
 
 	var order Order
 	id := c.Param("id")
 
-	if err := db.First(&order, id).Error; err != nil {
+	start := time.Now()
+	err := db.WithContext(ctx).First(&order, id).Error
+	instruments.RecordDBOperation(ctx, "SELECT", "orders", start)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 		span.RecordError(fmt.Errorf("Order not found"))
 		return
@@ -173,13 +167,16 @@ func getOrder(c *gin.Context) {
 }
 
 func updateOrder(c *gin.Context) {
-	_, span := otel.Tracer("order-service").Start(c.Request.Context(), "updateOrder")
+	ctx, span := otel.Tracer("order-service").Start(c.Request.Context(), "updateOrder")
 	defer span.End()
 
 	var order Order
 	id := c.Param("id")
 
-	if err := db.First(&order, id).Error; err != nil {
+	start := time.Now()
+	err := db.WithContext(ctx).First(&order, id).Error
+	instruments.RecordDBOperation(ctx, "SELECT", "orders", start)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 		span.RecordError(fmt.Errorf("Order not found"))
 		return
@@ -190,7 +187,10 @@ func updateOrder(c *gin.Context) {
 		return
 	}
 
-	if err := db.Save(&order).Error; err != nil {
+	start = time.Now()
+	err = db.WithContext(ctx).Save(&order).Error
+	instruments.RecordDBOperation(ctx, "UPDATE", "orders", start)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		span.RecordError(err)
 		return
@@ -204,20 +204,26 @@ func updateOrder(c *gin.Context) {
 }
 
 func payOrder(c *gin.Context) {
-	_, span := otel.Tracer("order-service").Start(c.Request.Context(), "payOrder")
+	ctx, span := otel.Tracer("order-service").Start(c.Request.Context(), "payOrder")
 	defer span.End()
 
 	var order Order
 	id := c.Param("id")
 
-	if err := db.First(&order, id).Error; err != nil {
+	start := time.Now()
+	err := db.WithContext(ctx).First(&order, id).Error
+	instruments.RecordDBOperation(ctx, "SELECT", "orders", start)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 		span.RecordError(fmt.Errorf("no order exists with id %s", id))
 		return
 	}
 	order.Paid = true
 
-	if err := db.Save(&order).Error; err != nil {
+	start = time.Now()
+	err = db.WithContext(ctx).Save(&order).Error
+	instruments.RecordDBOperation(ctx, "UPDATE", "orders", start)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -3,33 +3,31 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"time"
 
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/gin-gonic/gin"
-	_ "github.com/go-sql-driver/mysql"
-	"github.com/jinzhu/gorm"
+	"github.com/mbaykara/opentelemetry-webshop/pkg/httpserver"
+	"github.com/mbaykara/opentelemetry-webshop/pkg/metrics"
+	"github.com/mbaykara/opentelemetry-webshop/pkg/msg"
+	"github.com/mbaykara/opentelemetry-webshop/pkg/tracing"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"github.com/uptrace/opentelemetry-go-extra/otelgorm"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
-	"go.opentelemetry.io/otel/propagation"
-	"go.opentelemetry.io/otel/sdk/resource"
-	"go.opentelemetry.io/otel/trace"
-
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	otelmetric "go.opentelemetry.io/otel/metric"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
 )
 
 type Payment struct {
-	ID      uint   `json:"id" gorm:"primary_key"`
+	ID      uint   `json:"id" gorm:"primaryKey"`
 	OrderID uint   `json:"order_id"`
 	Amount  int    `json:"amount"`
 	Status  string `json:"status"`
@@ -37,31 +35,11 @@ type Payment struct {
 
 const PORT = "8091"
 
-var db *gorm.DB
-
-func initTracer() (*sdktrace.TracerProvider, error) {
-	otlp_endpoint := os.Getenv("OTLP_ENDPOINT")
-	if otlp_endpoint == "" {
-		log.Println("OTLP_ENDPOINT is not set, using tempo")
-		otlp_endpoint = "tempo:4317"
-	}
-	exporter, err := otlptracegrpc.New(context.Background(), otlptracegrpc.WithEndpoint(otlp_endpoint), otlptracegrpc.WithInsecure())
-	if err != nil {
-		return nil, err
-	}
-
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
-		sdktrace.WithResource(resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.ServiceNameKey.String("payment-service"),
-		)),
-	)
-
-	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
-	return tp, nil
-}
+var (
+	db          *gorm.DB
+	instruments *metrics.Instruments
+	publisher   message.Publisher
+)
 
 func main() {
 
@@ -71,16 +49,24 @@ func main() {
 	dbPassword := os.Getenv("DB_PASSWORD")
 	dbName := os.Getenv("DB_NAME")
 	dbHost := os.Getenv("DB_HOST")
-	db, err = gorm.Open("mysql", dbUser+":"+dbPassword+"@tcp("+dbHost+":3306)/"+dbName+"?parseTime=True")
+	dsn := dbUser + ":" + dbPassword + "@tcp(" + dbHost + ":3306)/" + dbName + "?parseTime=True"
+	db, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
 	if err != nil {
 		panic(err)
 	}
-	defer db.Close()
+	if err := db.Use(otelgorm.NewPlugin()); err != nil {
+		panic(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		panic(err)
+	}
+	defer sqlDB.Close()
 
 	// Auto-migrate the schema
 	db.AutoMigrate(&Payment{})
 
-	tp, err := initTracer()
+	tp, err := tracing.Init(context.Background(), "payment-service")
 	if err != nil {
 		panic(err)
 	}
@@ -90,25 +76,28 @@ func main() {
 		}
 	}()
 
+	mp, instr, err := metrics.Init(context.Background(), "payment-service")
+	if err != nil {
+		panic(err)
+	}
+	instruments = instr
+	defer func() {
+		if err := mp.Shutdown(context.Background()); err != nil {
+			panic(err)
+		}
+	}()
+
+	publisher, err = msg.NewPublisher(watermill.NewStdLogger(false, false))
+	if err != nil {
+		panic(err)
+	}
+
 	// Init Gin router
-	router := gin.Default()
-	router.Use(func(c *gin.Context) {
-		ctx := c.Request.Context()
-		traceID := trace.SpanFromContext(ctx).SpanContext().TraceID()
-		c.Set("traceID", traceID.String())
-		c.Next()
-	}, gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
-		return fmt.Sprintf("clientIP: %s Method: %s Path: %s Req: %s StatusCode %d Latency: %s Agent: %s traceID: %s\"\n",
-			param.ClientIP,
-			param.Method,
-			param.Path,
-			param.Request.Proto,
-			param.StatusCode,
-			param.Latency,
-			param.Request.UserAgent(),
-			param.Keys["traceID"].(string),
-		)
-	}))
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.Use(httpserver.Middleware("payment-service", logger, instruments)...)
 
 	// Define routes
 	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
@@ -133,7 +122,10 @@ func processPayment(c *gin.Context) {
 	defer dbSpan.End()
 
 	// Create payment in database
-	if err := db.Create(&payment).Error; err != nil {
+	start := time.Now()
+	err := db.WithContext(ctx).Create(&payment).Error
+	instruments.RecordDBOperation(ctx, "INSERT", "payments", start)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		dbSpan.RecordError(err)
 		dbSpan.SetStatus(codes.Error, "Failed to create payment in DB")
@@ -145,44 +137,36 @@ func processPayment(c *gin.Context) {
 		attribute.Int("amount", payment.Amount),
 	)
 
-	orderservice := os.Getenv("ORDER_SERVICE")
-	if orderservice == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "ORDER_SERVICE is not set"})
-		return
+	event := msg.PaymentCompleted{
+		PaymentID: payment.ID,
+		OrderID:   payment.OrderID,
+		Amount:    payment.Amount,
+		Status:    payment.Status,
 	}
-
-	reqBody, _ := json.Marshal(map[string]bool{"paid": true})
-	orderURL := fmt.Sprintf("%s/orders/%d/pay", orderservice, payment.OrderID)
-	req, err := http.NewRequestWithContext(ctx, "PUT", orderURL, bytes.NewBuffer(reqBody))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create request to order service"})
+	if err := msg.PublishPaymentCompleted(ctx, publisher, event); err != nil {
 		dbSpan.RecordError(err)
+		dbSpan.SetStatus(codes.Error, "Failed to publish payment completed event")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish payment completed event"})
 		return
 	}
-	req.Header.Set("Content-Type", "application/json")
-
-	ctx, span := otel.Tracer("payment-service").Start(ctx, "update order service")
-	// Start a new span for the HTTP request
-	_, httpSpan := tracer.Start(ctx, "update order service")
-	defer httpSpan.End()
-	client := &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
-	resp, err := client.Do(req)
-	if err != nil || resp.StatusCode != http.StatusOK {
-		span.RecordError(err)
-		span.SetStatus(codes.Error, "Failed to update order service")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order service"})
-		return
-	}
+
+	instruments.PaymentsProcessed.Add(ctx, 1, otelmetric.WithAttributes(
+		attribute.String("status", payment.Status),
+	))
+
 	c.JSON(http.StatusCreated, payment)
 }
 
 func getPayment(c *gin.Context) {
-	_, span := otel.Tracer("payment-service").Start(c.Request.Context(), "getPayment")
+	ctx, span := otel.Tracer("payment-service").Start(c.Request.Context(), "getPayment")
 	defer span.End()
 	var payment Payment
 	id := c.Param("id")
 
-	if err := db.First(&payment, id).Error; err != nil {
+	start := time.Now()
+	err := db.WithContext(ctx).First(&payment, id).Error
+	instruments.RecordDBOperation(ctx, "SELECT", "payments", start)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -0,0 +1,80 @@
+package httpserver
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/oklog/ulid/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxBaggageValueLen bounds tenant.id/user.id/request.id, whichever source
+// they arrived from (incoming W3C baggage or the X-Request-ID header), so a
+// hostile or buggy caller can't bloat spans and baggage propagated to every
+// downstream hop and, via BaggageSpanProcessor, onto every span in the
+// trace.
+const maxBaggageValueLen = 128
+
+// requestContext reads tenant.id/user.id/request.id off incoming W3C
+// Baggage, falling back to the X-Request-ID header and finally a generated
+// ULID for request.id. It stamps all three on the current span and writes
+// them back into the request's baggage so they ride along on any outbound
+// call made through otelhttp.NewTransport.
+func requestContext() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		bag := baggage.FromContext(ctx)
+
+		tenantID := capBaggageValue(bag.Member("tenant.id").Value())
+		userID := capBaggageValue(bag.Member("user.id").Value())
+
+		requestID := capBaggageValue(bag.Member("request.id").Value())
+		if requestID == "" {
+			requestID = capBaggageValue(c.GetHeader("X-Request-ID"))
+		}
+		if requestID == "" {
+			requestID = ulid.Make().String()
+		}
+
+		if tenantID != "" {
+			bag = withMember(bag, "tenant.id", tenantID)
+		}
+		if userID != "" {
+			bag = withMember(bag, "user.id", userID)
+		}
+		bag = withMember(bag, "request.id", requestID)
+		ctx = baggage.ContextWithBaggage(ctx, bag)
+		c.Request = c.Request.WithContext(ctx)
+
+		trace.SpanFromContext(ctx).SetAttributes(
+			attribute.String("tenant.id", tenantID),
+			attribute.String("user.id", userID),
+			attribute.String("request.id", requestID),
+		)
+
+		c.Next()
+	}
+}
+
+// capBaggageValue truncates value to maxBaggageValueLen, regardless of
+// whether it arrived via the baggage header or another source.
+func capBaggageValue(value string) string {
+	if len(value) > maxBaggageValueLen {
+		return value[:maxBaggageValueLen]
+	}
+	return value
+}
+
+// withMember returns bag with key set to value, or bag unchanged if value
+// isn't a valid baggage member value.
+func withMember(bag baggage.Baggage, key, value string) baggage.Baggage {
+	member, err := baggage.NewMember(key, value)
+	if err != nil {
+		return bag
+	}
+	updated, err := bag.SetMember(member)
+	if err != nil {
+		return bag
+	}
+	return updated
+}
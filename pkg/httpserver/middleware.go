@@ -0,0 +1,82 @@
+// Package httpserver provides the Gin middleware shared by order-service and
+// payment-service: request tracing via otelgin and a structured request
+// logger that carries trace context, replacing the old ad-hoc middleware
+// that only read the trace ID back out after the handler had already run.
+package httpserver
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mbaykara/opentelemetry-webshop/pkg/metrics"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware returns the tracing, metrics and logging middleware chain for
+// serviceName. It skips /metrics (so scrapes don't spam spans) and any
+// request gin couldn't match to a route, so 404s don't create empty,
+// untemplated spans.
+func Middleware(serviceName string, logger *slog.Logger, instruments *metrics.Instruments) gin.HandlersChain {
+	tracingMiddleware := otelgin.Middleware(serviceName, otelgin.WithFilter(func(r *http.Request) bool {
+		return r.URL.Path != "/metrics"
+	}))
+
+	return gin.HandlersChain{
+		func(c *gin.Context) {
+			if c.FullPath() == "" {
+				c.Next()
+				return
+			}
+			tracingMiddleware(c)
+		},
+		requestContext(),
+		redMetrics(instruments),
+		requestLogger(logger),
+	}
+}
+
+// redMetrics records http.server.request.duration and
+// http.server.active_requests around every request.
+func redMetrics(instruments *metrics.Instruments) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		instruments.HTTPActiveRequests.Add(c.Request.Context(), 1)
+		defer instruments.HTTPActiveRequests.Add(c.Request.Context(), -1)
+
+		start := time.Now()
+		c.Next()
+
+		instruments.HTTPRequestDuration.Record(c.Request.Context(), time.Since(start).Seconds(),
+			metric.WithAttributes(
+				attribute.String("http.method", c.Request.Method),
+				attribute.String("http.route", c.FullPath()),
+				attribute.Int("http.status_code", c.Writer.Status()),
+			),
+		)
+	}
+}
+
+// requestLogger emits one structured log line per request carrying the
+// trace/span IDs of the current span so logs can be correlated with traces
+// in Loki/Tempo.
+func requestLogger(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		sc := trace.SpanFromContext(c.Request.Context()).SpanContext()
+
+		logger.Info("http request",
+			"trace_id", sc.TraceID().String(),
+			"span_id", sc.SpanID().String(),
+			"http.method", c.Request.Method,
+			"http.route", c.FullPath(),
+			"http.status_code", c.Writer.Status(),
+			"latency", time.Since(start).String(),
+		)
+	}
+}
@@ -0,0 +1,164 @@
+// Package metrics sets up the OpenTelemetry Metrics pipeline shared by
+// order-service and payment-service. Metrics are exported both over OTLP
+// (to the same collector traces go to) and through a Prometheus bridge, so
+// the existing `/metrics` endpoint keeps working unchanged.
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+
+	"github.com/mbaykara/opentelemetry-webshop/pkg/tracing"
+)
+
+// defaultShutdownTimeout mirrors pkg/tracing: don't hang pod termination on
+// a dead collector.
+const defaultShutdownTimeout = 5 * time.Second
+
+// Instruments groups the RED (rate/errors/duration) and business metrics
+// every service records.
+type Instruments struct {
+	HTTPRequestDuration metric.Float64Histogram
+	HTTPActiveRequests  metric.Int64UpDownCounter
+	DBOperationDuration metric.Float64Histogram
+	OrdersCreated       metric.Int64Counter
+	PaymentsProcessed   metric.Int64Counter
+}
+
+// Provider wraps a MeterProvider with a bounded Shutdown.
+type Provider struct {
+	mp *sdkmetric.MeterProvider
+}
+
+// Init builds and installs the global MeterProvider for serviceName and
+// returns the instruments handlers use to record RED and business metrics.
+func Init(ctx context.Context, serviceName string) (*Provider, *Instruments, error) {
+	res, err := tracing.NewResource(ctx, serviceName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("metrics: building resource: %w", err)
+	}
+
+	endpoint := os.Getenv("OTLP_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "tempo:4317"
+	}
+	otlpExporter, err := otlpmetricgrpc.New(ctx,
+		otlpmetricgrpc.WithEndpoint(endpoint),
+		otlpmetricgrpc.WithInsecure(),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("metrics: creating OTLP exporter: %w", err)
+	}
+
+	promExporter, err := otelprom.New()
+	if err != nil {
+		return nil, nil, fmt.Errorf("metrics: creating Prometheus exporter: %w", err)
+	}
+
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithResource(res),
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(otlpExporter)),
+		sdkmetric.WithReader(promExporter),
+		sdkmetric.WithView(dropHighCardinalityAttributes()),
+	)
+	otel.SetMeterProvider(mp)
+
+	instruments, err := newInstruments(mp.Meter(serviceName))
+	if err != nil {
+		return nil, nil, fmt.Errorf("metrics: creating instruments: %w", err)
+	}
+
+	return &Provider{mp: mp}, instruments, nil
+}
+
+// dropHighCardinalityAttributes keeps the http.server.* histograms bounded
+// to method/route/status, dropping any raw-path attributes a contrib
+// instrumentation library might otherwise attach.
+func dropHighCardinalityAttributes() sdkmetric.View {
+	return sdkmetric.NewView(
+		sdkmetric.Instrument{Name: "http.server.*"},
+		sdkmetric.Stream{AttributeFilter: attribute.NewAllowKeysFilter(
+			"http.method", "http.route", "http.status_code",
+		)},
+	)
+}
+
+func newInstruments(meter metric.Meter) (*Instruments, error) {
+	httpDuration, err := meter.Float64Histogram(
+		"http.server.request.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Duration of inbound HTTP requests"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	activeRequests, err := meter.Int64UpDownCounter(
+		"http.server.active_requests",
+		metric.WithDescription("Number of in-flight HTTP requests"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	dbDuration, err := meter.Float64Histogram(
+		"db.client.operation.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Duration of DB operations"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ordersCreated, err := meter.Int64Counter(
+		"orders.created",
+		metric.WithDescription("Number of orders created"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	paymentsProcessed, err := meter.Int64Counter(
+		"payments.processed",
+		metric.WithDescription("Number of payments processed"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Instruments{
+		HTTPRequestDuration: httpDuration,
+		HTTPActiveRequests:  activeRequests,
+		DBOperationDuration: dbDuration,
+		OrdersCreated:       ordersCreated,
+		PaymentsProcessed:   paymentsProcessed,
+	}, nil
+}
+
+// RecordDBOperation records db.client.operation.duration for a query that
+// started at start, tagged with the OTel DB semantic convention attributes.
+func (i *Instruments) RecordDBOperation(ctx context.Context, operation, table string, start time.Time) {
+	i.DBOperationDuration.Record(ctx, time.Since(start).Seconds(),
+		metric.WithAttributes(
+			attribute.String("db.operation", operation),
+			attribute.String("db.sql.table", table),
+		),
+	)
+}
+
+// Shutdown flushes and stops the meter provider, giving up after
+// defaultShutdownTimeout so a dead collector can't hang pod termination.
+func (p *Provider) Shutdown(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, defaultShutdownTimeout)
+	defer cancel()
+	return p.mp.Shutdown(ctx)
+}
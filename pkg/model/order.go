@@ -0,0 +1,13 @@
+// Package model holds the data types shared between order-service and
+// order-consumer so the two binaries can't drift on the schema.
+package model
+
+// Order is a customer order. PaymentID records which payment last marked it
+// paid, so the consumer can dedup a redelivered PaymentCompleted event.
+type Order struct {
+	ID        uint   `json:"id" gorm:"primaryKey"`
+	Item      string `json:"item"`
+	Amount    int    `json:"amount"`
+	Paid      bool   `json:"paid"`
+	PaymentID uint   `json:"payment_id"`
+}
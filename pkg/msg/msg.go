@@ -0,0 +1,140 @@
+// Package msg carries the PaymentCompleted event from payment-service to
+// order-service over Watermill, replacing the synchronous HTTP callback that
+// left payments stuck whenever order-service was briefly unavailable. Kafka
+// backs production traffic; an in-memory gochannel pub/sub is available for
+// tests that run publisher and subscriber against the same instance.
+package msg
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-kafka/v3/pkg/kafka"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PaymentCompletedTopic is the topic payment-service publishes to and
+// order-consumer subscribes on.
+const PaymentCompletedTopic = "payment.completed"
+
+// PaymentCompleted is emitted once a payment has been charged successfully.
+type PaymentCompleted struct {
+	PaymentID uint   `json:"payment_id"`
+	OrderID   uint   `json:"order_id"`
+	Amount    int    `json:"amount"`
+	Status    string `json:"status"`
+}
+
+// NewPublisher returns a Kafka publisher, or a new in-memory GoChannel when
+// PUBSUB_BACKEND=inmem. That GoChannel is not shared with NewSubscriber or
+// with any other process, so its messages reach only subscribers of that
+// same instance.
+func NewPublisher(logger watermill.LoggerAdapter) (message.Publisher, error) {
+	if os.Getenv("PUBSUB_BACKEND") == "inmem" {
+		return NewInMemoryPubSub(logger), nil
+	}
+
+	return kafka.NewPublisher(kafka.PublisherConfig{
+		Brokers:   kafkaBrokers(),
+		Marshaler: kafka.DefaultMarshaler{},
+	}, logger)
+}
+
+// NewSubscriber returns a Kafka subscriber in the "order-service" consumer
+// group, or an in-memory one when PUBSUB_BACKEND=inmem.
+func NewSubscriber(logger watermill.LoggerAdapter) (message.Subscriber, error) {
+	if os.Getenv("PUBSUB_BACKEND") == "inmem" {
+		return NewInMemoryPubSub(logger), nil
+	}
+
+	return kafka.NewSubscriber(kafka.SubscriberConfig{
+		Brokers:       kafkaBrokers(),
+		Unmarshaler:   kafka.DefaultMarshaler{},
+		ConsumerGroup: "order-service",
+	}, logger)
+}
+
+// NewInMemoryPubSub returns a gochannel pub/sub that satisfies both
+// message.Publisher and message.Subscriber, for tests that shouldn't need a
+// real broker.
+func NewInMemoryPubSub(logger watermill.LoggerAdapter) *gochannel.GoChannel {
+	return gochannel.NewGoChannel(gochannel.Config{}, logger)
+}
+
+func kafkaBrokers() []string {
+	return strings.Split(os.Getenv("KAFKA_BROKERS"), ",")
+}
+
+// PublishPaymentCompleted publishes event, injecting the current trace
+// context into the message metadata so order-consumer's span can be linked
+// back to this one.
+func PublishPaymentCompleted(ctx context.Context, publisher message.Publisher, event PaymentCompleted) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	ctx, span := otel.Tracer("payment-service").Start(ctx, "publish "+PaymentCompletedTopic,
+		trace.WithSpanKind(trace.SpanKindProducer),
+	)
+	defer span.End()
+
+	m := message.NewMessage(watermill.NewUUID(), payload)
+	otel.GetTextMapPropagator().Inject(ctx, metadataCarrier(m.Metadata))
+
+	return publisher.Publish(PaymentCompletedTopic, m)
+}
+
+// ExtractPaymentCompleted decodes m's payload and starts a consumer span
+// linked to the producer span recorded in its metadata. The span is left
+// open in the returned ctx: the caller runs the actual business logic
+// against it and must end it once that work completes, so the span's
+// duration and status reflect the handler, not just this decode step. If
+// the payload fails to decode, the error is recorded on the span and the
+// span is ended here before returning.
+func ExtractPaymentCompleted(m *message.Message) (PaymentCompleted, context.Context, error) {
+	producerCtx := otel.GetTextMapPropagator().Extract(context.Background(), metadataCarrier(m.Metadata))
+	link := trace.LinkFromContext(producerCtx)
+
+	ctx, span := otel.Tracer("order-service").Start(context.Background(), "consume "+PaymentCompletedTopic,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithLinks(link),
+	)
+
+	var event PaymentCompleted
+	if err := json.Unmarshal(m.Payload, &event); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "failed to unmarshal payment.completed payload")
+		span.End()
+		return PaymentCompleted{}, ctx, err
+	}
+
+	return event, ctx, nil
+}
+
+// metadataCarrier adapts Watermill's message.Metadata to
+// propagation.TextMapCarrier so trace context can ride in message headers.
+type metadataCarrier message.Metadata
+
+func (c metadataCarrier) Get(key string) string {
+	return message.Metadata(c).Get(key)
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	message.Metadata(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,99 @@
+package msg_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/mbaykara/opentelemetry-webshop/pkg/msg"
+)
+
+// TestPublishPaymentCompletedSingleSpan guards against the class of bug that
+// used to double-start processPayment's "update order service" span: a
+// publish must record exactly one span, and it must be ended.
+func TestPublishPaymentCompletedSingleSpan(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+
+	pubsub := msg.NewInMemoryPubSub(watermill.NewStdLogger(false, false))
+	t.Cleanup(func() { _ = pubsub.Close() })
+
+	event := msg.PaymentCompleted{PaymentID: 1, OrderID: 2, Amount: 100, Status: "success"}
+	if err := msg.PublishPaymentCompleted(context.Background(), pubsub, event); err != nil {
+		t.Fatalf("PublishPaymentCompleted: %v", err)
+	}
+
+	wantName := "publish " + msg.PaymentCompletedTopic
+	var matched int
+	for _, s := range exporter.GetSpans() {
+		if s.Name != wantName {
+			continue
+		}
+		matched++
+		if s.EndTime.IsZero() {
+			t.Errorf("span %q was never ended", s.Name)
+		}
+	}
+	if matched != 1 {
+		t.Errorf("got %d spans named %q, want exactly 1", matched, wantName)
+	}
+}
+
+// TestExtractPaymentCompletedLeavesSpanOpen guards against the premature-End
+// bug where ExtractPaymentCompleted ended the consumer span itself, so any
+// error from the handler's business logic (run after extraction, against
+// the returned ctx) was never attached to it. The span must still be open
+// when ExtractPaymentCompleted returns, and only recorded once the caller
+// ends it.
+func TestExtractPaymentCompletedLeavesSpanOpen(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+
+	event := msg.PaymentCompleted{PaymentID: 1, OrderID: 2, Amount: 100, Status: "success"}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	m := message.NewMessage(watermill.NewUUID(), payload)
+
+	got, ctx, err := msg.ExtractPaymentCompleted(m)
+	if err != nil {
+		t.Fatalf("ExtractPaymentCompleted: %v", err)
+	}
+	if got != event {
+		t.Errorf("got event %+v, want %+v", got, event)
+	}
+
+	wantName := "consume " + msg.PaymentCompletedTopic
+	if len(exporter.GetSpans()) != 0 {
+		t.Fatalf("span %q was recorded (ended) before the caller finished its business logic", wantName)
+	}
+
+	span := trace.SpanFromContext(ctx)
+	span.End()
+
+	var matched int
+	for _, s := range exporter.GetSpans() {
+		if s.Name != wantName {
+			continue
+		}
+		matched++
+		if s.EndTime.IsZero() {
+			t.Errorf("span %q was never ended", s.Name)
+		}
+	}
+	if matched != 1 {
+		t.Errorf("got %d spans named %q, want exactly 1", matched, wantName)
+	}
+}
@@ -0,0 +1,55 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// DefaultBaggageAllowlist is the set of baggage members stamped onto every
+// span by BaggageSpanProcessor. pkg/httpserver's request-context middleware
+// is what actually populates these members on incoming requests.
+var DefaultBaggageAllowlist = []string{"tenant.id", "user.id", "request.id"}
+
+// maxBaggageValueLen bounds the value copied onto a span's attributes.
+// pkg/httpserver already caps these at the edge, but OnStart runs for every
+// span in every trace, including ones reached via baggage that never passed
+// through that middleware (e.g. propagated straight through by an
+// upstream service), so it caps independently rather than trusting the
+// caller to have done so.
+const maxBaggageValueLen = 128
+
+// BaggageSpanProcessor copies baggage members named in Allowlist onto every
+// span's attributes as it starts, so tenant/user/request filtering works in
+// Tempo/Jaeger without every handler having to remember SetAttributes.
+type BaggageSpanProcessor struct {
+	Allowlist []string
+}
+
+// NewBaggageSpanProcessor returns a SpanProcessor that stamps the given
+// baggage member names onto every span's attributes at OnStart.
+func NewBaggageSpanProcessor(allowlist ...string) *BaggageSpanProcessor {
+	return &BaggageSpanProcessor{Allowlist: allowlist}
+}
+
+// OnStart copies any allow-listed baggage member present in ctx onto span.
+func (p *BaggageSpanProcessor) OnStart(ctx context.Context, span sdktrace.ReadWriteSpan) {
+	bag := baggage.FromContext(ctx)
+	for _, key := range p.Allowlist {
+		if member := bag.Member(key); member.Key() != "" {
+			value := member.Value()
+			if len(value) > maxBaggageValueLen {
+				value = value[:maxBaggageValueLen]
+			}
+			span.SetAttributes(attribute.String(key, value))
+		}
+	}
+}
+
+func (p *BaggageSpanProcessor) OnEnd(sdktrace.ReadOnlySpan) {}
+
+func (p *BaggageSpanProcessor) Shutdown(context.Context) error { return nil }
+
+func (p *BaggageSpanProcessor) ForceFlush(context.Context) error { return nil }
@@ -0,0 +1,142 @@
+// Package tracing sets up the OpenTelemetry tracer provider shared by
+// order-service and payment-service, replacing the duplicated initTracer
+// that used to live in each service's main.go.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+)
+
+// defaultShutdownTimeout bounds how long Shutdown waits on the collector
+// before giving up, so pod termination doesn't hang on a dead exporter.
+const defaultShutdownTimeout = 5 * time.Second
+
+// Provider wraps a TracerProvider with a bounded Shutdown and installs
+// itself as the global tracer provider and propagator on Init.
+type Provider struct {
+	tp *sdktrace.TracerProvider
+}
+
+// Init builds and installs the global TracerProvider for serviceName. The
+// OTLP endpoint, exporter protocol and sampler are all configurable via
+// environment variables so the two services can be tuned independently in
+// each deployment.
+func Init(ctx context.Context, serviceName string) (*Provider, error) {
+	exporter, err := newExporter(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("tracing: creating exporter: %w", err)
+	}
+
+	res, err := NewResource(ctx, serviceName)
+	if err != nil {
+		return nil, fmt.Errorf("tracing: building resource: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(newSampler()),
+		sdktrace.WithSpanProcessor(NewBaggageSpanProcessor(DefaultBaggageAllowlist...)),
+	)
+
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	return &Provider{tp: tp}, nil
+}
+
+// newExporter picks otlptracegrpc or otlptracehttp based on
+// OTEL_EXPORTER_OTLP_PROTOCOL, defaulting to grpc to match prior behavior.
+func newExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	endpoint := os.Getenv("OTLP_ENDPOINT")
+	if endpoint == "" {
+		log.Println("OTLP_ENDPOINT is not set, using tempo")
+		endpoint = "tempo:4317"
+	}
+
+	switch strings.ToLower(os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")) {
+	case "http/protobuf", "http":
+		return otlptracehttp.New(ctx,
+			otlptracehttp.WithEndpoint(endpoint),
+			otlptracehttp.WithInsecure(),
+		)
+	default:
+		return otlptracegrpc.New(ctx,
+			otlptracegrpc.WithEndpoint(endpoint),
+			otlptracegrpc.WithInsecure(),
+		)
+	}
+}
+
+// NewResource enriches the service.name with version/environment plus host
+// and process attributes pulled from the environment. It is shared with
+// pkg/metrics so traces and metrics report identical resource attributes.
+func NewResource(ctx context.Context, serviceName string) (*resource.Resource, error) {
+	version := os.Getenv("SERVICE_VERSION")
+	if version == "" {
+		version = "dev"
+	}
+	env := os.Getenv("DEPLOYMENT_ENVIRONMENT")
+	if env == "" {
+		env = "development"
+	}
+
+	return resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithHostID(),
+		resource.WithProcess(),
+		resource.WithSchemaURL(semconv.SchemaURL),
+		resource.WithAttributes(
+			semconv.ServiceNameKey.String(serviceName),
+			semconv.ServiceVersionKey.String(version),
+			semconv.DeploymentEnvironmentKey.String(env),
+		),
+	)
+}
+
+// newSampler reads OTEL_TRACES_SAMPLER / OTEL_TRACES_SAMPLER_ARG, defaulting
+// to parentbased_traceidratio with a ratio of 1 (sample everything).
+func newSampler() sdktrace.Sampler {
+	ratio := 1.0
+	if v := os.Getenv("OTEL_TRACES_SAMPLER_ARG"); v != "" {
+		if r, err := strconv.ParseFloat(v, 64); err == nil {
+			ratio = r
+		}
+	}
+
+	switch os.Getenv("OTEL_TRACES_SAMPLER") {
+	case "always_on":
+		return sdktrace.AlwaysSample()
+	case "always_off":
+		return sdktrace.NeverSample()
+	case "traceidratio":
+		return sdktrace.TraceIDRatioBased(ratio)
+	default:
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))
+	}
+}
+
+// Shutdown flushes and stops the tracer provider, giving up after
+// defaultShutdownTimeout so a dead collector can't hang pod termination.
+func (p *Provider) Shutdown(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, defaultShutdownTimeout)
+	defer cancel()
+	return p.tp.Shutdown(ctx)
+}
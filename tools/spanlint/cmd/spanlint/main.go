@@ -0,0 +1,12 @@
+// Command spanlint runs the spanlint analyzer as a standalone go vet tool.
+package main
+
+import (
+	"golang.org/x/tools/go/analysis/singlechecker"
+
+	"github.com/mbaykara/opentelemetry-webshop/tools/spanlint"
+)
+
+func main() {
+	singlechecker.Main(spanlint.Analyzer)
+}
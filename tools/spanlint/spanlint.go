@@ -0,0 +1,78 @@
+// Package spanlint implements a go vet-style analyzer that flags spans
+// returned from a tracer.Start call that are never deferred .End()'d in the
+// same function. This is exactly the shape of bug that used to leave
+// processPayment's first "update order service" span unended.
+package spanlint
+
+import (
+	"go/ast"
+	"go/token"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// Analyzer flags tracer.Start(...) results whose span variable has no
+// matching "defer <name>.End()" in the enclosing function.
+var Analyzer = &analysis.Analyzer{
+	Name: "spanlint",
+	Doc:  "reports span variables from a Start(...) call that are never deferred .End()'d",
+	Run:  run,
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	for _, file := range pass.Files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			if fn, ok := n.(*ast.FuncDecl); ok && fn.Body != nil {
+				checkFunc(pass, fn)
+			}
+			return true
+		})
+	}
+	return nil, nil
+}
+
+// checkFunc collects every span variable assigned from a call whose method
+// is named Start, then reports any that aren't deferred .End()'d in fn.
+func checkFunc(pass *analysis.Pass, fn *ast.FuncDecl) {
+	spans := map[string]token.Pos{}
+
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		assign, ok := n.(*ast.AssignStmt)
+		if !ok || len(assign.Lhs) != 2 || len(assign.Rhs) != 1 {
+			return true
+		}
+		call, ok := assign.Rhs[0].(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || sel.Sel.Name != "Start" {
+			return true
+		}
+		spanIdent, ok := assign.Lhs[1].(*ast.Ident)
+		if !ok || spanIdent.Name == "_" {
+			return true
+		}
+		spans[spanIdent.Name] = spanIdent.Pos()
+		return true
+	})
+
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		d, ok := n.(*ast.DeferStmt)
+		if !ok {
+			return true
+		}
+		sel, ok := d.Call.Fun.(*ast.SelectorExpr)
+		if !ok || sel.Sel.Name != "End" {
+			return true
+		}
+		if ident, ok := sel.X.(*ast.Ident); ok {
+			delete(spans, ident.Name)
+		}
+		return true
+	})
+
+	for name, pos := range spans {
+		pass.Reportf(pos, "span %q from tracer.Start is never deferred .End()'d in this function", name)
+	}
+}
@@ -0,0 +1,13 @@
+package spanlint_test
+
+import (
+	"testing"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+
+	"github.com/mbaykara/opentelemetry-webshop/tools/spanlint"
+)
+
+func TestAnalyzer(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), spanlint.Analyzer, "a")
+}
@@ -0,0 +1,22 @@
+package a
+
+type span struct{}
+
+func (span) End() {}
+
+type tracer struct{}
+
+func (tracer) Start(name string) (int, span) { return 0, span{} }
+
+func good() {
+	t := tracer{}
+	_, s := t.Start("ok")
+	defer s.End()
+	_ = s
+}
+
+func bad() {
+	t := tracer{}
+	_, s := t.Start("oops") // want `span "s" from tracer.Start is never deferred .End\(\)'d in this function`
+	_ = s
+}